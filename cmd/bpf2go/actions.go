@@ -0,0 +1,138 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// action is a node in the build graph executed by runActions. It mirrors the
+// post-order DAG walk used by cmd/go/internal/work: an action only runs once
+// every action in deps has completed successfully.
+type action struct {
+	name string
+	deps []*action
+	run  func(ctx context.Context) error
+
+	// log buffers debug output produced while the action runs so that
+	// concurrent actions don't interleave their output. It is flushed to
+	// stdout in DAG order once the action completes.
+	log bytes.Buffer
+
+	err  error
+	done chan struct{}
+}
+
+// newAction creates an action named name that invokes run once every action
+// in deps has finished successfully.
+func newAction(name string, deps []*action, run func(ctx context.Context) error) *action {
+	return &action{name: name, deps: deps, run: run, done: make(chan struct{})}
+}
+
+// wait blocks until the action has finished and returns its error, if any.
+func (a *action) wait() error {
+	<-a.done
+	return a.err
+}
+
+// allActions returns the transitive closure of roots in post-order, so that
+// dependencies always appear before the actions that depend on them.
+func allActions(roots []*action) []*action {
+	var (
+		order   []*action
+		visited = make(map[*action]bool)
+	)
+
+	var visit func(a *action)
+	visit = func(a *action) {
+		if visited[a] {
+			return
+		}
+		visited[a] = true
+		for _, dep := range a.deps {
+			visit(dep)
+		}
+		order = append(order, a)
+	}
+
+	for _, root := range roots {
+		visit(root)
+	}
+
+	return order
+}
+
+// runActions executes the DAG rooted at roots using a pool of workers
+// goroutines that drain a ready queue: an action becomes ready as soon as all
+// of its dependencies have completed successfully. The first error
+// encountered cancels ctx, which stops sibling actions from starting, and is
+// returned once every started action has settled. Per-action debug output is
+// flushed to stdout in DAG order so that output remains deterministic
+// regardless of scheduling.
+func runActions(ctx context.Context, stdout io.Writer, workers int, roots []*action) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	all := allActions(roots)
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var firstErr error
+
+	for _, a := range all {
+		wg.Add(1)
+		go func(a *action) {
+			defer wg.Done()
+			defer close(a.done)
+
+			for _, dep := range a.deps {
+				if err := dep.wait(); err != nil {
+					a.err = fmt.Errorf("%s: dependency %s failed", a.name, dep.name)
+					return
+				}
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				a.err = ctx.Err()
+				return
+			}
+			defer func() { <-sem }()
+
+			if err := ctx.Err(); err != nil {
+				a.err = err
+				return
+			}
+
+			if err := a.run(ctx); err != nil {
+				a.err = fmt.Errorf("%s: %w", a.name, err)
+				errOnce.Do(func() {
+					firstErr = a.err
+					cancel()
+				})
+			}
+		}(a)
+	}
+
+	wg.Wait()
+
+	// Flush per-action logs in DAG order so output doesn't depend on which
+	// goroutine happened to finish first.
+	for _, a := range all {
+		if a.log.Len() > 0 {
+			io.Copy(stdout, &a.log)
+		}
+	}
+
+	return firstErr
+}
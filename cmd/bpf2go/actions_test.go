@@ -0,0 +1,65 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestRunActionsOrder(t *testing.T) {
+	var ranA, ranB int32
+
+	a := newAction("a", nil, func(ctx context.Context) error {
+		atomic.StoreInt32(&ranA, 1)
+		return nil
+	})
+	b := newAction("b", []*action{a}, func(ctx context.Context) error {
+		if atomic.LoadInt32(&ranA) == 0 {
+			return errors.New("b ran before its dependency a")
+		}
+		atomic.StoreInt32(&ranB, 1)
+		return nil
+	})
+
+	err := runActions(context.Background(), &discardWriter{}, 2, []*action{b})
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(atomic.LoadInt32(&ranB), int32(1)))
+}
+
+func TestRunActionsPropagatesError(t *testing.T) {
+	boom := errors.New("boom")
+
+	failing := newAction("failing", nil, func(ctx context.Context) error {
+		return boom
+	})
+	dependent := newAction("dependent", []*action{failing}, func(ctx context.Context) error {
+		t.Fatal("dependent action must not run after its dependency failed")
+		return nil
+	})
+
+	err := runActions(context.Background(), &discardWriter{}, 2, []*action{dependent})
+	qt.Assert(t, qt.IsNotNil(err))
+	qt.Assert(t, qt.StringContains(err.Error(), "failing"))
+}
+
+type discardWriter struct{}
+
+func (*discardWriter) Write(p []byte) (int, error) { return len(p), nil }
+
+func TestAllActionsIsPostOrder(t *testing.T) {
+	noop := func(ctx context.Context) error { return nil }
+
+	leaf := newAction("leaf", nil, noop)
+	mid := newAction("mid", []*action{leaf}, noop)
+	root := newAction("root", []*action{mid}, noop)
+
+	all := allActions([]*action{root})
+	qt.Assert(t, qt.Equals(len(all), 3))
+	qt.Assert(t, qt.Equals(all[0].name, "leaf"))
+	qt.Assert(t, qt.Equals(all[len(all)-1].name, "root"))
+}
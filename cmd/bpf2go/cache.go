@@ -0,0 +1,331 @@
+//go:build !windows
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cacheTrimAge is how long an unused cache entry is kept around before
+// trim opportunistically deletes it.
+const cacheTrimAge = 30 * 24 * time.Hour
+
+// buildCache is a content-addressed cache for compiled BPF objects, modeled
+// on cmd/go/internal/cache: the action ID is a hash of everything that
+// influences the output of a single compileOne invocation, and hits are
+// served by copying the cached .o into place instead of invoking the
+// compiler.
+type buildCache struct {
+	dir string
+}
+
+// defaultCacheDir returns $BPF2GO_CACHE if set, otherwise a bpf2go
+// subdirectory of $GOCACHE (falling back to the user's cache directory, akin
+// to how the Go toolchain resolves GOCACHE).
+func defaultCacheDir() string {
+	if dir := os.Getenv("BPF2GO_CACHE"); dir != "" {
+		return dir
+	}
+
+	if dir := os.Getenv("GOCACHE"); dir != "" {
+		return filepath.Join(dir, "bpf2go")
+	}
+
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "go-build", "bpf2go")
+	}
+
+	return ""
+}
+
+func newBuildCache(dir string) (*buildCache, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no cache directory")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("create cache directory: %w", err)
+	}
+	return &buildCache{dir: dir}, nil
+}
+
+// cacheRecipe captures everything that determines a compileOne action's
+// output, except for the contents of the source file and the headers it
+// transitively includes, which are only known once the dependency list has
+// been produced (either by this compile or a previous one).
+type cacheRecipe struct {
+	CC         string
+	CCVersion  string
+	Strip      string
+	StripVer   string
+	Target     string
+	CFlags     []string
+	NoStrip    bool
+	SourcePath string
+}
+
+func (r cacheRecipe) hash() string {
+	h := sha256.New()
+	fmt.Fprintln(h, r.CC, r.CCVersion)
+	fmt.Fprintln(h, r.Strip, r.StripVer, r.NoStrip)
+	fmt.Fprintln(h, r.Target)
+	fmt.Fprintln(h, r.SourcePath)
+	for _, f := range r.CFlags {
+		fmt.Fprintln(h, f)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cacheManifest is persisted per recipe hash so that the next invocation can
+// tell, without recompiling, whether the source and every header it last
+// depended on are unchanged.
+type cacheManifest struct {
+	ActionID     string
+	SourceHash   string
+	HeaderHashes map[string]string
+	Deps         []cachedDependency
+}
+
+// cachedDependency is the serialized form of a dependency, whose fields are
+// unexported and would otherwise be dropped by encoding/json.
+type cachedDependency struct {
+	File      string
+	DependsOn []string
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func (c *buildCache) manifestPath(recipeHash string) string {
+	return filepath.Join(c.dir, recipeHash+".manifest.json")
+}
+
+func (c *buildCache) objectPath(actionID string) string {
+	return filepath.Join(c.dir, actionID+".o")
+}
+
+func (c *buildCache) loadManifest(recipeHash string) (*cacheManifest, error) {
+	data, err := os.ReadFile(c.manifestPath(recipeHash))
+	if err != nil {
+		return nil, err
+	}
+
+	var m cacheManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// lookup returns the deps recorded for a previous compile of this recipe if
+// the cached object is still present and the source and every header it
+// depended on match their recorded hashes.
+func (c *buildCache) lookup(recipeHash, sourcePath string) (deps []dependency, actionID string, ok bool) {
+	m, err := c.loadManifest(recipeHash)
+	if err != nil {
+		return nil, "", false
+	}
+
+	sourceHash, err := hashFile(sourcePath)
+	if err != nil || sourceHash != m.SourceHash {
+		return nil, "", false
+	}
+
+	for header, want := range m.HeaderHashes {
+		got, err := hashFile(header)
+		if err != nil || got != want {
+			return nil, "", false
+		}
+	}
+
+	if _, err := os.Stat(c.objectPath(m.ActionID)); err != nil {
+		return nil, "", false
+	}
+
+	for _, dep := range m.Deps {
+		deps = append(deps, dependency{file: dep.File, dependsOn: dep.DependsOn})
+	}
+	return deps, m.ActionID, true
+}
+
+// store saves objFileName under the cache and records a manifest that lets a
+// future lookup for the same recipe skip recompilation as long as the
+// source and headers in deps don't change.
+func (c *buildCache) store(recipeHash, sourcePath, objFileName string, deps []dependency) error {
+	sourceHash, err := hashFile(sourcePath)
+	if err != nil {
+		return err
+	}
+
+	headerHashes := make(map[string]string)
+	var headers []string
+	for _, dep := range deps {
+		headers = append(headers, dep.dependsOn...)
+	}
+	sort.Strings(headers)
+	for _, header := range headers {
+		if _, ok := headerHashes[header]; ok {
+			continue
+		}
+		hash, err := hashFile(header)
+		if err != nil {
+			// Headers can legitimately disappear between configure and
+			// build (generated headers, etc); simply don't cache on them.
+			continue
+		}
+		headerHashes[header] = hash
+	}
+
+	h := sha256.New()
+	fmt.Fprintln(h, recipeHash, sourceHash)
+	for _, header := range headers {
+		fmt.Fprintln(h, header, headerHashes[header])
+	}
+	actionID := hex.EncodeToString(h.Sum(nil))
+
+	if err := copyFile(c.objectPath(actionID), objFileName); err != nil {
+		return fmt.Errorf("populate cache: %w", err)
+	}
+
+	var cachedDeps []cachedDependency
+	for _, dep := range deps {
+		cachedDeps = append(cachedDeps, cachedDependency{File: dep.file, DependsOn: dep.dependsOn})
+	}
+
+	m := cacheManifest{
+		ActionID:     actionID,
+		SourceHash:   sourceHash,
+		HeaderHashes: headerHashes,
+		Deps:         cachedDeps,
+	}
+
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	manifestPath := c.manifestPath(recipeHash)
+	tmpFile, err := os.CreateTemp(c.dir, filepath.Base(manifestPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := tmpFile.Name()
+
+	if _, err := tmpFile.Write(data); err != nil {
+		tmpFile.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, manifestPath)
+}
+
+func (c *buildCache) restore(actionID, dest string) error {
+	if err := copyFile(dest, c.objectPath(actionID)); err != nil {
+		return err
+	}
+
+	// Mark the cached object as used so that trim's mtime-based eviction
+	// keeps entries that are hit regularly, not just ones recently written.
+	now := time.Now()
+	if err := os.Chtimes(c.objectPath(actionID), now, now); err != nil {
+		return fmt.Errorf("touch cache entry: %w", err)
+	}
+	return nil
+}
+
+// copyFile copies src to dest via a per-process-unique temporary file in the
+// same directory followed by a rename, so that two bpf2go processes that
+// race to populate the same cache entry (e.g. identical recipe and source
+// hashing to the same actionID across packages or CI shards) never write
+// through the same temporary path and corrupt each other's copy.
+func copyFile(dest, src string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := out.Name()
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, dest)
+}
+
+// trim opportunistically removes cache entries that haven't been used in
+// maxAge, mirroring the mtime-based policy of cmd/go/internal/cache. It is
+// called best-effort after a store and never returns an error that should
+// fail the build.
+func (c *buildCache) trim(maxAge time.Duration) {
+	marker := filepath.Join(c.dir, "trim.marker")
+	if info, err := os.Stat(marker); err == nil && time.Since(info.ModTime()) < 24*time.Hour {
+		return
+	}
+
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-maxAge)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".o") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+		os.Remove(filepath.Join(c.dir, entry.Name()))
+	}
+
+	os.WriteFile(marker, nil, 0o644)
+}
+
+// ccVersion shells out to `binary --version` and returns its output verbatim
+// so it can be folded into the cache recipe; a changed compiler version must
+// invalidate every cache entry that used it.
+func ccVersion(binary string) string {
+	out, err := exec.Command(binary, "--version").CombinedOutput()
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
@@ -0,0 +1,117 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestBuildCacheHitAfterStore(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := newBuildCache(dir)
+	qt.Assert(t, qt.IsNil(err))
+
+	source := filepath.Join(dir, "test.c")
+	mustWriteFile(t, dir, "test.c", "int main() { return 0; }")
+
+	header := filepath.Join(dir, "test.h")
+	mustWriteFile(t, dir, "test.h", "#define FOO 1")
+
+	obj := filepath.Join(dir, "test.o")
+	mustWriteFile(t, dir, "test.o", "not really an ELF file")
+
+	deps := []dependency{{file: source, dependsOn: []string{header}}}
+
+	recipe := cacheRecipe{CC: "clang", Target: "bpfel", SourcePath: source}
+	recipeHash := recipe.hash()
+
+	qt.Assert(t, qt.IsNil(cache.store(recipeHash, source, obj, deps)))
+
+	restoredDeps, actionID, ok := cache.lookup(recipeHash, source)
+	qt.Assert(t, qt.IsTrue(ok))
+	qt.Assert(t, qt.Not(qt.Equals(actionID, "")))
+	qt.Assert(t, qt.IsTrue(reflect.DeepEqual(restoredDeps, deps)))
+
+	dest := filepath.Join(dir, "restored.o")
+	qt.Assert(t, qt.IsNil(cache.restore(actionID, dest)))
+
+	have, err := os.ReadFile(dest)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(string(have), "not really an ELF file"))
+}
+
+func TestBuildCacheStoreConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := newBuildCache(dir)
+	qt.Assert(t, qt.IsNil(err))
+
+	source := filepath.Join(dir, "test.c")
+	mustWriteFile(t, dir, "test.c", "int main() { return 0; }")
+
+	obj := filepath.Join(dir, "test.o")
+	mustWriteFile(t, dir, "test.o", "not really an ELF file")
+
+	recipe := cacheRecipe{CC: "clang", Target: "bpfel", SourcePath: source}
+	recipeHash := recipe.hash()
+
+	// Simulate two bpf2go processes racing to populate the same cache entry,
+	// which happens whenever they compute the same actionID (identical
+	// recipe, source and headers). Neither store must corrupt the other's
+	// object or manifest.
+	const n = 10
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := cache.store(recipeHash, source, obj, nil); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	_, actionID, ok := cache.lookup(recipeHash, source)
+	qt.Assert(t, qt.IsTrue(ok))
+
+	dest := filepath.Join(dir, "restored.o")
+	qt.Assert(t, qt.IsNil(cache.restore(actionID, dest)))
+
+	have, err := os.ReadFile(dest)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(string(have), "not really an ELF file"))
+}
+
+func TestBuildCacheMissOnHeaderChange(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := newBuildCache(dir)
+	qt.Assert(t, qt.IsNil(err))
+
+	source := filepath.Join(dir, "test.c")
+	mustWriteFile(t, dir, "test.c", "int main() { return 0; }")
+
+	header := filepath.Join(dir, "test.h")
+	mustWriteFile(t, dir, "test.h", "#define FOO 1")
+
+	obj := filepath.Join(dir, "test.o")
+	mustWriteFile(t, dir, "test.o", "stale object")
+
+	deps := []dependency{{file: source, dependsOn: []string{header}}}
+
+	recipe := cacheRecipe{CC: "clang", Target: "bpfel", SourcePath: source}
+	recipeHash := recipe.hash()
+
+	qt.Assert(t, qt.IsNil(cache.store(recipeHash, source, obj, deps)))
+
+	// Changing a header the source depends on must invalidate the entry.
+	mustWriteFile(t, dir, "test.h", "#define FOO 2")
+
+	_, _, ok := cache.lookup(recipeHash, source)
+	qt.Assert(t, qt.IsFalse(ok))
+}
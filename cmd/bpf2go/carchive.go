@@ -0,0 +1,216 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// buildMode selects what kind of artifact convert emits alongside the
+// generated Go skeleton.
+type buildMode string
+
+const (
+	buildModeGo       buildMode = "go"
+	buildModeCArchive buildMode = "c-archive"
+	buildModeCShared  buildMode = "c-shared"
+)
+
+func parseBuildMode(s string) (buildMode, error) {
+	switch buildMode(s) {
+	case buildModeGo, buildModeCArchive, buildModeCShared:
+		return buildMode(s), nil
+	default:
+		return "", fmt.Errorf("invalid -buildmode %q: must be one of %q, %q, %q",
+			s, buildModeGo, buildModeCArchive, buildModeCShared)
+	}
+}
+
+// writeCSkeleton emits a libbpf-style skeleton for spec: a header declaring
+// the `<stem>_bpf` struct and its open_and_load/attach/destroy API, and a
+// generated .c stub implementing that API against the compiled BPF object,
+// which is embedded as a byte array so the resulting archive or shared
+// object is self-contained. The stub is compiled and packaged with cc, so
+// producing buildModeCArchive/buildModeCShared requires a libbpf
+// installation visible to the system C compiler.
+func writeCSkeleton(cc string, mode buildMode, stem, outDir, objFileName string, spec *ebpf.CollectionSpec) error {
+	objData, err := os.ReadFile(objFileName)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", objFileName, err)
+	}
+
+	maps, programs := mapAndProgramNames(spec)
+
+	headerPath := filepath.Join(outDir, stem+".h")
+	header, err := os.Create(headerPath)
+	if err != nil {
+		return err
+	}
+	defer header.Close()
+
+	if err := generateCHeader(header, stem, maps, programs); err != nil {
+		return fmt.Errorf("write %s: %w", headerPath, err)
+	}
+
+	sourcePath := filepath.Join(outDir, stem+".c")
+	source, err := os.Create(sourcePath)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	if err := generateCSource(source, stem, maps, programs, objData); err != nil {
+		return fmt.Errorf("write %s: %w", sourcePath, err)
+	}
+
+	// Compile the stub to a host object. From here on the embedded BPF
+	// bytes make it self-contained: the original, target-specific
+	// objFileName is no longer needed to satisfy the consumer's linker,
+	// which is why it's safe to package a host object instead of the raw
+	// BPF-ISA one.
+	hostObjPath := filepath.Join(outDir, stem+"_skel.o")
+	compile := exec.Command(cc, "-c", "-o", hostObjPath, sourcePath)
+	if out, err := compile.CombinedOutput(); err != nil {
+		return fmt.Errorf("compile %s: %w\n%s", sourcePath, err, out)
+	}
+	defer os.Remove(hostObjPath)
+
+	switch mode {
+	case buildModeCArchive:
+		archivePath := filepath.Join(outDir, stem+".a")
+		cmd := exec.Command("ar", "rcs", archivePath, hostObjPath)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("ar: %w\n%s", err, out)
+		}
+	case buildModeCShared:
+		sharedPath := filepath.Join(outDir, stem+".so")
+		cmd := exec.Command(cc, "-shared", "-o", sharedPath, hostObjPath, "-lbpf")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("cc -shared: %w\n%s", err, out)
+		}
+	}
+
+	return nil
+}
+
+// mapAndProgramNames returns the sorted map and program names that make up
+// the skeleton, skipping internal sections like .rodata/.data/.bss the same
+// way the Go skeleton does.
+func mapAndProgramNames(spec *ebpf.CollectionSpec) (maps, programs []string) {
+	for name := range spec.Maps {
+		if !strings.HasPrefix(name, ".") {
+			maps = append(maps, name)
+		}
+	}
+	sort.Strings(maps)
+
+	for name := range spec.Programs {
+		programs = append(programs, name)
+	}
+	sort.Strings(programs)
+
+	return maps, programs
+}
+
+// generateCHeader writes a libbpf-style skeleton header: a struct with one
+// field per map and program, plus one bpf_link per program to hold the
+// result of attach, and open/attach/destroy declarations following libbpf's
+// <name>_bpf__<verb> naming.
+func generateCHeader(w io.Writer, stem string, maps, programs []string) error {
+	guard := strings.ToUpper(stem) + "_SKEL_H"
+
+	fmt.Fprint(w, "/* Code generated by bpf2go; DO NOT EDIT. */\n\n")
+	fmt.Fprintf(w, "#ifndef %s\n#define %s\n\n", guard, guard)
+	fmt.Fprint(w, "#include <bpf/libbpf.h>\n\n")
+
+	fmt.Fprintf(w, "struct %s_bpf {\n", stem)
+	fmt.Fprint(w, "\tstruct bpf_object *obj;\n")
+	for _, name := range maps {
+		fmt.Fprintf(w, "\tstruct bpf_map *%s;\n", name)
+	}
+	for _, name := range programs {
+		fmt.Fprintf(w, "\tstruct bpf_program *%s;\n", name)
+	}
+	for _, name := range programs {
+		fmt.Fprintf(w, "\tstruct bpf_link *%s_link;\n", name)
+	}
+	fmt.Fprint(w, "};\n\n")
+
+	fmt.Fprintf(w, "struct %s_bpf *%s_bpf__open_and_load(void);\n", stem, stem)
+	fmt.Fprintf(w, "int %s_bpf__attach(struct %s_bpf *skel);\n", stem, stem)
+	fmt.Fprintf(w, "void %s_bpf__destroy(struct %s_bpf *skel);\n\n", stem, stem)
+
+	fmt.Fprintf(w, "#endif /* %s */\n", guard)
+	return nil
+}
+
+// generateCSource writes the implementation of the <stem>_bpf__* functions
+// declared in the header produced by generateCHeader. The compiled BPF
+// object is embedded as a static byte array (objData) so that the resulting
+// .o/.a/.so carries everything it needs to open and load the program
+// without the caller having to ship the original .o alongside it.
+func generateCSource(w io.Writer, stem string, maps, programs []string, objData []byte) error {
+	fmt.Fprint(w, "/* Code generated by bpf2go; DO NOT EDIT. */\n\n")
+	fmt.Fprint(w, "#include <stdlib.h>\n")
+	fmt.Fprint(w, "#include <bpf/libbpf.h>\n\n")
+	fmt.Fprintf(w, "#include \"%s.h\"\n\n", stem)
+
+	fmt.Fprintf(w, "static const unsigned char %s_bpf_elf_data[] = {\n", stem)
+	for i, b := range objData {
+		if i%12 == 0 {
+			fmt.Fprint(w, "\t")
+		}
+		fmt.Fprintf(w, "0x%02x,", b)
+		if i%12 == 11 {
+			fmt.Fprint(w, "\n")
+		} else {
+			fmt.Fprint(w, " ")
+		}
+	}
+	fmt.Fprint(w, "\n};\n\n")
+
+	fmt.Fprintf(w, "struct %s_bpf *%s_bpf__open_and_load(void)\n{\n", stem, stem)
+	fmt.Fprintf(w, "\tstruct %s_bpf *skel = calloc(1, sizeof(*skel));\n", stem)
+	fmt.Fprint(w, "\tif (!skel)\n\t\treturn NULL;\n\n")
+	fmt.Fprintf(w, "\tskel->obj = bpf_object__open_mem(%s_bpf_elf_data, sizeof(%s_bpf_elf_data), NULL);\n", stem, stem)
+	fmt.Fprint(w, "\tif (!skel->obj)\n\t\tgoto err_free;\n\n")
+	fmt.Fprint(w, "\tif (bpf_object__load(skel->obj))\n\t\tgoto err_close;\n\n")
+	for _, name := range maps {
+		fmt.Fprintf(w, "\tskel->%s = bpf_object__find_map_by_name(skel->obj, %q);\n", name, name)
+	}
+	for _, name := range programs {
+		fmt.Fprintf(w, "\tskel->%s = bpf_object__find_program_by_name(skel->obj, %q);\n", name, name)
+	}
+	fmt.Fprint(w, "\n\treturn skel;\n\n")
+	fmt.Fprint(w, "err_close:\n\tbpf_object__close(skel->obj);\n")
+	fmt.Fprint(w, "err_free:\n\tfree(skel);\n\treturn NULL;\n}\n\n")
+
+	fmt.Fprintf(w, "int %s_bpf__attach(struct %s_bpf *skel)\n{\n", stem, stem)
+	if len(programs) > 0 {
+		fmt.Fprint(w, "\tstruct bpf_link *link;\n\n")
+	}
+	for _, name := range programs {
+		fmt.Fprintf(w, "\tlink = bpf_program__attach(skel->%s);\n", name)
+		fmt.Fprint(w, "\tif (libbpf_get_error(link))\n\t\treturn -1;\n")
+		fmt.Fprintf(w, "\tskel->%s_link = link;\n\n", name)
+	}
+	fmt.Fprint(w, "\treturn 0;\n}\n\n")
+
+	fmt.Fprintf(w, "void %s_bpf__destroy(struct %s_bpf *skel)\n{\n", stem, stem)
+	fmt.Fprint(w, "\tif (!skel)\n\t\treturn;\n\n")
+	for _, name := range programs {
+		fmt.Fprintf(w, "\tbpf_link__destroy(skel->%s_link);\n", name)
+	}
+	fmt.Fprint(w, "\tbpf_object__close(skel->obj);\n")
+	fmt.Fprint(w, "\tfree(skel);\n}\n")
+
+	return nil
+}
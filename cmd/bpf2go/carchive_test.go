@@ -0,0 +1,166 @@
+//go:build !windows
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestParseBuildMode(t *testing.T) {
+	for _, valid := range []string{"go", "c-archive", "c-shared"} {
+		mode, err := parseBuildMode(valid)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(string(mode), valid))
+	}
+
+	_, err := parseBuildMode("c-static-lib")
+	qt.Assert(t, qt.IsNotNil(err))
+}
+
+func TestGenerateCHeader(t *testing.T) {
+	var buf bytes.Buffer
+	qt.Assert(t, qt.IsNil(generateCHeader(&buf, "bar", []string{"my_map"}, []string{"my_prog"})))
+
+	have := buf.String()
+	qt.Assert(t, qt.StringContains(have, "struct bar_bpf {"))
+	qt.Assert(t, qt.StringContains(have, "struct bpf_map *my_map;"))
+	qt.Assert(t, qt.StringContains(have, "struct bpf_program *my_prog;"))
+	qt.Assert(t, qt.StringContains(have, "struct bpf_link *my_prog_link;"))
+	qt.Assert(t, qt.StringContains(have, "bar_bpf__open_and_load"))
+}
+
+// hostCCanSeeLibbpf reports whether the system C compiler can find
+// <bpf/libbpf.h> and a linkable libbpf, which is what writeCSkeleton needs to
+// turn a stub into a real .a/.so.
+func hostCCanSeeLibbpf(t *testing.T, cc string) bool {
+	t.Helper()
+
+	dir := t.TempDir()
+	mustWriteFile(t, dir, "probe.c", `#include <bpf/libbpf.h>
+int main(void) { return bpf_object__open_mem(0, 0, 0) != 0; }`)
+
+	out := filepath.Join(dir, "probe")
+	cmd := exec.Command(cc, filepath.Join(dir, "probe.c"), "-lbpf", "-o", out)
+	return cmd.Run() == nil
+}
+
+func TestCArchiveBuildMode(t *testing.T) {
+	if _, err := exec.LookPath("ar"); err != nil {
+		t.Skip("ar is not available:", err)
+	}
+	if !hostCCanSeeLibbpf(t, "cc") {
+		t.Skip("system C compiler can't find a development libbpf")
+	}
+
+	clangBin := testutils.ClangBin(t)
+	dir := t.TempDir()
+	mustWriteFile(t, dir, "test.c", minimalSocketFilter)
+
+	outDir := t.TempDir()
+
+	err := run(io.Discard, []string{
+		"-go-package", "main",
+		"-output-dir", outDir,
+		"-cc", clangBin,
+		"-target", "bpfel",
+		"-buildmode", "c-archive",
+		"bar",
+		filepath.Join(dir, "test.c"),
+	})
+	qt.Assert(t, qt.IsNil(err))
+
+	for _, suffix := range []string{".h", ".c", ".a"} {
+		path := filepath.Join(outDir, "bar_bpfel"+suffix)
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("c-archive buildmode should produce %s: %s", path, err)
+		}
+	}
+
+	// Prove the header and archive actually link: a consumer that only
+	// knows about bar_bpfel.h must be able to open, attach and destroy the
+	// skeleton, whose C names are derived from the per-target stem.
+	mustWriteFile(t, outDir, "consumer.c", `#include "bar_bpfel.h"
+
+int main(void) {
+	struct bar_bpfel_bpf *skel = bar_bpfel_bpf__open_and_load();
+	if (!skel)
+		return 1;
+	if (bar_bpfel_bpf__attach(skel))
+		return 1;
+	bar_bpfel_bpf__destroy(skel);
+	return 0;
+}
+`)
+
+	consumer := filepath.Join(outDir, "consumer")
+	link := exec.Command("cc",
+		filepath.Join(outDir, "consumer.c"),
+		filepath.Join(outDir, "bar_bpfel.a"),
+		"-lbpf", "-o", consumer)
+	link.Dir = outDir
+	if out, err := link.CombinedOutput(); err != nil {
+		t.Fatalf("link consumer against generated header+archive: %s\n%s", err, out)
+	}
+}
+
+func TestCSharedBuildMode(t *testing.T) {
+	if !hostCCanSeeLibbpf(t, "cc") {
+		t.Skip("system C compiler can't find a development libbpf")
+	}
+
+	clangBin := testutils.ClangBin(t)
+	dir := t.TempDir()
+	mustWriteFile(t, dir, "test.c", minimalSocketFilter)
+
+	outDir := t.TempDir()
+
+	err := run(io.Discard, []string{
+		"-go-package", "main",
+		"-output-dir", outDir,
+		"-cc", clangBin,
+		"-target", "bpfel",
+		"-buildmode", "c-shared",
+		"bar",
+		filepath.Join(dir, "test.c"),
+	})
+	qt.Assert(t, qt.IsNil(err))
+
+	for _, suffix := range []string{".h", ".c", ".so"} {
+		path := filepath.Join(outDir, "bar_bpfel"+suffix)
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("c-shared buildmode should produce %s: %s", path, err)
+		}
+	}
+
+	mustWriteFile(t, outDir, "consumer.c", `#include "bar_bpfel.h"
+
+int main(void) {
+	struct bar_bpfel_bpf *skel = bar_bpfel_bpf__open_and_load();
+	if (!skel)
+		return 1;
+	if (bar_bpfel_bpf__attach(skel))
+		return 1;
+	bar_bpfel_bpf__destroy(skel);
+	return 0;
+}
+`)
+
+	consumer := filepath.Join(outDir, "consumer")
+	link := exec.Command("cc",
+		filepath.Join(outDir, "consumer.c"),
+		filepath.Join(outDir, "bar_bpfel.so"),
+		"-lbpf", "-Wl,-rpath,"+outDir, "-o", consumer)
+	link.Dir = outDir
+	if out, err := link.CombinedOutput(); err != nil {
+		t.Fatalf("link consumer against generated header+shared object: %s\n%s", err, out)
+	}
+}
@@ -0,0 +1,72 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// compileCommand is a single entry of a LLVM JSON Compilation Database, as
+// consumed by clangd/ccls and other static analyzers.
+type compileCommand struct {
+	Directory string   `json:"directory"`
+	File      string   `json:"file"`
+	Arguments []string `json:"arguments"`
+	Output    string   `json:"output"`
+}
+
+// appendCompileCommand merges cmd into the compile_commands.json at path,
+// replacing any existing entry for the same (file, output) pair, and writes
+// the result back atomically (write-temp-then-rename) so that concurrent
+// bpf2go invocations across a repository can safely share one database. The
+// read-modify-write is serialized across processes with an flock on a
+// sidecar lock file, since compileCommandsMu only protects against
+// concurrent writers within a single bpf2go process.
+func appendCompileCommand(path string, cmd compileCommand) error {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("open lock file: %w", err)
+	}
+	defer lock.Close()
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock %s: %w", lock.Name(), err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	var commands []compileCommand
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &commands); err != nil {
+			return fmt.Errorf("parse existing %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	replaced := false
+	for i, existing := range commands {
+		if existing.File == cmd.File && existing.Output == cmd.Output {
+			commands[i] = cmd
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		commands = append(commands, cmd)
+	}
+
+	data, err := json.MarshalIndent(commands, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
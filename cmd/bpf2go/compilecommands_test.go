@@ -0,0 +1,60 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestAppendCompileCommand(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "compile_commands.json")
+
+	first := compileCommand{
+		Directory: dir,
+		File:      "a.c",
+		Output:    "a.o",
+		Arguments: []string{"clang", "-c", "a.c", "-o", "a.o"},
+	}
+	qt.Assert(t, qt.IsNil(appendCompileCommand(path, first)))
+
+	second := compileCommand{
+		Directory: dir,
+		File:      "b.c",
+		Output:    "b.o",
+		Arguments: []string{"clang", "-c", "b.c", "-o", "b.o"},
+	}
+	qt.Assert(t, qt.IsNil(appendCompileCommand(path, second)))
+
+	var commands []compileCommand
+	data, err := os.ReadFile(path)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.IsNil(json.Unmarshal(data, &commands)))
+	qt.Assert(t, qt.Equals(len(commands), 2))
+
+	// Re-compiling the same (file, output) pair updates the entry in place
+	// instead of appending a duplicate.
+	updated := compileCommand{
+		Directory: dir,
+		File:      "a.c",
+		Output:    "a.o",
+		Arguments: []string{"clang", "-target", "bpfel", "-c", "a.c", "-o", "a.o"},
+	}
+	qt.Assert(t, qt.IsNil(appendCompileCommand(path, updated)))
+
+	data, err = os.ReadFile(path)
+	qt.Assert(t, qt.IsNil(err))
+	commands = nil
+	qt.Assert(t, qt.IsNil(json.Unmarshal(data, &commands)))
+	qt.Assert(t, qt.Equals(len(commands), 2))
+	qt.Assert(t, qt.DeepEquals(commands[0], updated))
+
+	// No stray temp file should be left behind.
+	_, err = os.Stat(path + ".tmp")
+	qt.Assert(t, qt.IsTrue(os.IsNotExist(err)))
+}
@@ -0,0 +1,66 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandParamsFiles expands any `@path` argument in args by reading the file
+// at path and splicing its shell-quoted tokens into its place, following the
+// same pattern as expandParamsFiles in rules_go's compilepkg. This lets
+// build systems that generate long argument lists (many source files, a long
+// -cflags string) write them to a params file instead of risking ARG_MAX, and
+// it lets Bazel/Buck-style rules feed bpf2go via a single `@path` argument.
+// `@path` references nested inside a params file are expanded recursively.
+func expandParamsFiles(args []string) ([]string, error) {
+	return expandParamsFilesVisited(args, make(map[string]bool))
+}
+
+// expandParamsFilesVisited does the work for expandParamsFiles, tracking the
+// absolute paths of params files already being expanded so that a file which
+// references itself, directly or through a chain, is rejected instead of
+// recursing forever.
+func expandParamsFilesVisited(args []string, visited map[string]bool) ([]string, error) {
+	var result []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "@") {
+			result = append(result, arg)
+			continue
+		}
+
+		path := strings.TrimPrefix(arg, "@")
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("resolve params file %q: %w", path, err)
+		}
+
+		if visited[absPath] {
+			return nil, fmt.Errorf("params file %q: cyclic @file reference", path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read params file %q: %w", path, err)
+		}
+
+		tokens, err := splitArguments(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse params file %q: %w", path, err)
+		}
+
+		visited[absPath] = true
+		expanded, err := expandParamsFilesVisited(tokens, visited)
+		delete(visited, absPath)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, expanded...)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestExpandParamsFiles(t *testing.T) {
+	dir := t.TempDir()
+	mustWriteFile(t, dir, "args.params", `-cflags "foo bar" baz`)
+
+	t.Run("relative", func(t *testing.T) {
+		cwd, err := os.Getwd()
+		qt.Assert(t, qt.IsNil(err))
+		t.Cleanup(func() { os.Chdir(cwd) })
+		qt.Assert(t, qt.IsNil(os.Chdir(dir)))
+
+		have, err := expandParamsFiles([]string{"first", "@args.params", "last"})
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.DeepEquals(have, []string{"first", "-cflags", "foo bar", "baz", "last"}))
+	})
+
+	t.Run("absolute", func(t *testing.T) {
+		abs := filepath.Join(dir, "args.params")
+
+		have, err := expandParamsFiles([]string{"first", "@" + abs, "last"})
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.DeepEquals(have, []string{"first", "-cflags", "foo bar", "baz", "last"}))
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		mustWriteFile(t, dir, "outer.params", "@"+filepath.Join(dir, "args.params")+" extra")
+
+		have, err := expandParamsFiles([]string{"@" + filepath.Join(dir, "outer.params")})
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.DeepEquals(have, []string{"-cflags", "foo bar", "baz", "extra"}))
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := expandParamsFiles([]string{"@" + filepath.Join(dir, "does-not-exist")})
+		qt.Assert(t, qt.IsNotNil(err))
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		a := filepath.Join(dir, "a.params")
+		b := filepath.Join(dir, "b.params")
+		mustWriteFile(t, dir, "a.params", "@"+b)
+		mustWriteFile(t, dir, "b.params", "@"+a)
+
+		_, err := expandParamsFiles([]string{"@" + a})
+		qt.Assert(t, qt.IsNotNil(err))
+	})
+}
@@ -23,6 +23,18 @@ import (
 const minimalSocketFilter = `__attribute__((section("socket"), used)) int main() { return 0; }`
 
 func TestRun(t *testing.T) {
+	for _, embed := range []bool{false, true} {
+		name := "bytes"
+		if embed {
+			name = "embed"
+		}
+		t.Run(name, func(t *testing.T) {
+			testRun(t, embed)
+		})
+	}
+}
+
+func testRun(t *testing.T, embed bool) {
 	clangBin := testutils.ClangBin(t)
 	dir := t.TempDir()
 	mustWriteFile(t, dir, "test.c", minimalSocketFilter)
@@ -66,19 +78,29 @@ func TestRun(t *testing.T) {
 		"s390x", // big-endian
 	}
 
-	err = run(io.Discard, []string{
+	args := []string{
 		"-go-package", "main",
 		"-output-dir", modDir,
 		"-cc", clangBin,
 		"-target", strings.Join(goarches, ","),
-		"bar",
-		filepath.Join(dir, "test.c"),
-	})
+	}
+	if embed {
+		args = append(args, "-embed")
+	}
+	args = append(args, "bar", filepath.Join(dir, "test.c"))
+
+	err = run(io.Discard, args)
 
 	if err != nil {
 		t.Fatal("Can't run:", err)
 	}
 
+	if embed {
+		if _, err := os.Stat(filepath.Join(modDir, "bar_bpfel.o")); err != nil {
+			t.Error("Embed mode should leave the compiled object next to the generated Go source:", err)
+		}
+	}
+
 	mustWriteFile(t, modDir, "main.go",
 		`
 package main
@@ -397,6 +419,83 @@ func TestParseArgs(t *testing.T) {
 		qt.Assert(t, qt.Equals(b2g.outputSuffix, "_test"))
 	})
 
+	t.Run("jobs defaults to NumCPU", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		args := []string{stem, csource}
+		b2g, err := newB2G(&bytes.Buffer{}, args)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(b2g.jobs, runtime.NumCPU()))
+	})
+
+	t.Run("jobs", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		args := []string{"-j", "3", stem, csource}
+		b2g, err := newB2G(&bytes.Buffer{}, args)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(b2g.jobs, 3))
+	})
+
+	t.Run("jobs from env", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		t.Setenv("BPF2GO_JOBS", "2")
+		args := []string{stem, csource}
+		b2g, err := newB2G(&bytes.Buffer{}, args)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(b2g.jobs, 2))
+	})
+
+	t.Run("embed defaults to false", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		b2g, err := newB2G(&bytes.Buffer{}, []string{stem, csource})
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.IsFalse(b2g.embed))
+	})
+
+	t.Run("embed flag", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		args := []string{"-embed", stem, csource}
+		b2g, err := newB2G(&bytes.Buffer{}, args)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.IsTrue(b2g.embed))
+	})
+
+	t.Run("embed from env", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		t.Setenv("BPF2GO_EMBED", "true")
+		b2g, err := newB2G(&bytes.Buffer{}, []string{stem, csource})
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.IsTrue(b2g.embed))
+	})
+
+	t.Run("buildmode defaults to go", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		b2g, err := newB2G(&bytes.Buffer{}, []string{stem, csource})
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(b2g.buildMode, buildModeGo))
+	})
+
+	t.Run("buildmode c-archive", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		args := []string{"-buildmode", "c-archive", stem, csource}
+		b2g, err := newB2G(&bytes.Buffer{}, args)
+		qt.Assert(t, qt.IsNil(err))
+		qt.Assert(t, qt.Equals(b2g.buildMode, buildModeCArchive))
+	})
+
+	t.Run("buildmode invalid", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		args := []string{"-buildmode", "bogus", stem, csource}
+		_, err := newB2G(&bytes.Buffer{}, args)
+		qt.Assert(t, qt.IsNotNil(err))
+	})
+
+	t.Run("jobs must be positive", func(t *testing.T) {
+		t.Setenv(gopackageEnv, pkg)
+		args := []string{"-j", "0", stem, csource}
+		_, err := newB2G(&bytes.Buffer{}, args)
+		qt.Assert(t, qt.IsNotNil(err))
+	})
+
 	t.Run("output suffix custom", func(t *testing.T) {
 		t.Setenv(gopackageEnv, pkg)
 		t.Setenv("GOFILE", "foo_test.go")
@@ -0,0 +1,110 @@
+//go:build !windows
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"syscall"
+)
+
+// sumEntry records everything needed to reproduce and verify a single
+// target's compiled object: the exact inputs that were hashed, the toolchain
+// that was used, and the hash of the object that toolchain produced.
+type sumEntry struct {
+	Target       string
+	ObjectFile   string
+	Sources      map[string]string
+	Headers      map[string]string
+	CC           string
+	CCVersion    string
+	Strip        string
+	StripVersion string
+	NoStrip      bool
+	CFlags       []string
+	ObjectHash   string
+}
+
+// sumFile is the decoded form of bpf2go.sum, keyed by ObjectFile so that
+// repeated runs across targets in the same output directory accumulate into
+// one file instead of overwriting each other.
+type sumFile struct {
+	Entries map[string]sumEntry
+}
+
+func readSumFile(path string) (*sumFile, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &sumFile{Entries: make(map[string]sumEntry)}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var entries []sumEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	sf := &sumFile{Entries: make(map[string]sumEntry, len(entries))}
+	for _, e := range entries {
+		sf.Entries[e.ObjectFile] = e
+	}
+	return sf, nil
+}
+
+// writeSumFile writes out the sum file's entries sorted by object file name,
+// atomically, so that concurrent target builds in the same directory don't
+// corrupt it.
+func writeSumFile(path string, sf *sumFile) error {
+	names := make([]string, 0, len(sf.Entries))
+	for name := range sf.Entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]sumEntry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, sf.Entries[name])
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// mergeSumEntry reads the sum file at path, replaces or adds entry, and
+// writes the result back. The read-modify-write is serialized across
+// processes with an flock on a sidecar lock file: b2g.sumMu only protects
+// against concurrent target builds within a single bpf2go process, but
+// nothing stops two separate go:generate-spawned bpf2go invocations from
+// sharing the same output directory.
+func mergeSumEntry(path string, entry sumEntry) error {
+	lock, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("open lock file: %w", err)
+	}
+	defer lock.Close()
+
+	if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return fmt.Errorf("lock %s: %w", lock.Name(), err)
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	sf, err := readSumFile(path)
+	if err != nil {
+		return err
+	}
+
+	sf.Entries[entry.ObjectFile] = entry
+
+	return writeSumFile(path, sf)
+}
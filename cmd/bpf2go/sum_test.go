@@ -0,0 +1,87 @@
+//go:build !windows
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+)
+
+func TestMergeSumEntry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bpf2go.sum")
+
+	bpfel := sumEntry{
+		Target:     "bpfel",
+		ObjectFile: "bar_bpfel.o",
+		Sources:    map[string]string{"bar.c": "aaa"},
+		ObjectHash: "111",
+	}
+	qt.Assert(t, qt.IsNil(mergeSumEntry(path, bpfel)))
+
+	bpfeb := sumEntry{
+		Target:     "bpfeb",
+		ObjectFile: "bar_bpfeb.o",
+		Sources:    map[string]string{"bar.c": "aaa"},
+		ObjectHash: "222",
+	}
+	qt.Assert(t, qt.IsNil(mergeSumEntry(path, bpfeb)))
+
+	sf, err := readSumFile(path)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(len(sf.Entries), 2))
+	qt.Assert(t, qt.Equals(sf.Entries["bar_bpfel.o"].ObjectHash, "111"))
+	qt.Assert(t, qt.Equals(sf.Entries["bar_bpfeb.o"].ObjectHash, "222"))
+
+	// Recording a new hash for an existing object replaces its entry rather
+	// than appending a duplicate.
+	bpfel.ObjectHash = "333"
+	qt.Assert(t, qt.IsNil(mergeSumEntry(path, bpfel)))
+
+	sf, err = readSumFile(path)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(len(sf.Entries), 2))
+	qt.Assert(t, qt.Equals(sf.Entries["bar_bpfel.o"].ObjectHash, "333"))
+}
+
+func TestMergeSumEntryConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bpf2go.sum")
+
+	const n = 20
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entry := sumEntry{
+				Target:     "bpfel",
+				ObjectFile: fmt.Sprintf("bar%d_bpfel.o", i),
+				ObjectHash: fmt.Sprintf("%d", i),
+			}
+			if err := mergeSumEntry(path, entry); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	sf, err := readSumFile(path)
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(len(sf.Entries), n))
+	for i := 0; i < n; i++ {
+		entry, ok := sf.Entries[fmt.Sprintf("bar%d_bpfel.o", i)]
+		qt.Assert(t, qt.IsTrue(ok))
+		qt.Assert(t, qt.Equals(entry.ObjectHash, fmt.Sprintf("%d", i)))
+	}
+}
+
+func TestReadSumFileMissing(t *testing.T) {
+	sf, err := readSumFile(filepath.Join(t.TempDir(), "bpf2go.sum"))
+	qt.Assert(t, qt.IsNil(err))
+	qt.Assert(t, qt.Equals(len(sf.Entries), 0))
+}
@@ -0,0 +1,166 @@
+//go:build !windows
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/cilium/ebpf/cmd/bpf2go/gen"
+)
+
+// runVerify implements `bpf2go verify`: it parses the same flags as a normal
+// run (identifying which target/source combinations to check) and confirms
+// that recompiling each of them reproduces the object recorded in
+// bpf2go.sum, without touching any generated Go source.
+func runVerify(stdout io.Writer, args []string) error {
+	b2g, err := newB2G(stdout, args)
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+		return nil
+	default:
+		return err
+	}
+
+	return b2g.verifyAll()
+}
+
+// verifyAll checks every (target, source) combination in b2g against the
+// bpf2go.sum recorded in b2g.outputDir, analogous to `go mod verify`: it
+// fails if the sum is missing an entry, if a recorded source or header no
+// longer matches, or if recompiling from scratch produces a different
+// object than the one that was recorded.
+func (b2g *bpf2go) verifyAll() error {
+	absOutPath, err := filepath.Abs(b2g.outputDir)
+	if err != nil {
+		return err
+	}
+
+	sumPath := filepath.Join(absOutPath, "bpf2go.sum")
+	sf, err := readSumFile(sumPath)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", sumPath, err)
+	}
+
+	if !b2g.disableStripping {
+		if b2g.strip, err = exec.LookPath(b2g.strip); err != nil {
+			return err
+		}
+	}
+
+	scratch, err := os.MkdirTemp("", "bpf2go-verify")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(scratch)
+
+	outputStem := b2g.outputStem
+	if outputStem == "" {
+		outputStem = strings.ToLower(b2g.identStem)
+	}
+
+	for target := range b2g.targetArches {
+		stem := fmt.Sprintf("%s_%s%s", outputStem, target.Suffix(), b2g.outputSuffix)
+		objectFile := stem + ".o"
+
+		entry, ok := sf.Entries[objectFile]
+		if !ok {
+			return fmt.Errorf("verify %s: no entry in %s, run with -write-sum first", objectFile, sumPath)
+		}
+
+		if err := verifyEntry(b2g, target, entry, scratch); err != nil {
+			return fmt.Errorf("verify %s: %w", objectFile, err)
+		}
+
+		fmt.Fprintln(b2g.stdout, "ok", objectFile)
+	}
+
+	return nil
+}
+
+func verifyEntry(b2g *bpf2go, target gen.Target, entry sumEntry, scratch string) error {
+	wantSources := make([]string, 0, len(entry.Sources))
+	for source := range entry.Sources {
+		wantSources = append(wantSources, source)
+	}
+	slices.Sort(wantSources)
+
+	haveSources := slices.Clone(b2g.sourceFiles)
+	slices.Sort(haveSources)
+
+	if !slices.Equal(wantSources, haveSources) {
+		return fmt.Errorf("source files changed: recorded %v, have %v", wantSources, haveSources)
+	}
+
+	for source, wantHash := range entry.Sources {
+		hash, err := hashFile(source)
+		if err != nil {
+			return fmt.Errorf("hash %s: %w", source, err)
+		}
+		if hash != wantHash {
+			return fmt.Errorf("source %s no longer matches its recorded hash", source)
+		}
+	}
+
+	for header, wantHash := range entry.Headers {
+		hash, err := hashFile(header)
+		if err != nil {
+			return fmt.Errorf("hash %s: %w", header, err)
+		}
+		if hash != wantHash {
+			return fmt.Errorf("header %s no longer matches its recorded hash", header)
+		}
+	}
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	var tmpObjs []string
+	for _, source := range haveSources {
+		objFileName := filepath.Join(scratch, filepath.Base(source)+"."+target.Suffix()+".o")
+		err := gen.Compile(gen.CompileArgs{
+			CC:               b2g.cc,
+			Strip:            b2g.strip,
+			DisableStripping: b2g.disableStripping,
+			Flags:            entry.CFlags,
+			Target:           target,
+			Workdir:          cwd,
+			Source:           source,
+			Dest:             objFileName,
+		})
+		if err != nil {
+			return fmt.Errorf("recompile %s: %w", source, err)
+		}
+		tmpObjs = append(tmpObjs, objFileName)
+	}
+
+	finalObj := filepath.Join(scratch, entry.ObjectFile)
+	if len(tmpObjs) > 1 {
+		if err := gen.Link(gen.LinkArgs{Dest: finalObj, Sources: tmpObjs}); err != nil {
+			return fmt.Errorf("link: %w", err)
+		}
+	} else if err := os.Rename(tmpObjs[0], finalObj); err != nil {
+		return fmt.Errorf("rename object: %w", err)
+	}
+
+	hash, err := hashFile(finalObj)
+	if err != nil {
+		return err
+	}
+
+	if hash != entry.ObjectHash {
+		return fmt.Errorf("object is not reproducible: recorded %s, recompiled to %s", entry.ObjectHash, hash)
+	}
+
+	return nil
+}
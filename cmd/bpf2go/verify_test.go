@@ -0,0 +1,44 @@
+//go:build !windows
+
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-quicktest/qt"
+
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestVerify(t *testing.T) {
+	clangBin := testutils.ClangBin(t)
+	dir := t.TempDir()
+	mustWriteFile(t, dir, "test.h", "#define VALUE 1")
+	mustWriteFile(t, dir, "test.c", `#include "test.h"
+__attribute__((section("socket"), used)) int main() { return VALUE; }`)
+
+	outDir := t.TempDir()
+
+	args := []string{
+		"-go-package", "main",
+		"-output-dir", outDir,
+		"-cc", clangBin,
+		"-target", "bpfel",
+		"-write-sum",
+		"bar",
+		filepath.Join(dir, "test.c"),
+	}
+
+	qt.Assert(t, qt.IsNil(run(io.Discard, args)))
+
+	verifyArgs := append([]string{"verify"}, args...)
+	qt.Assert(t, qt.IsNil(run(io.Discard, verifyArgs)))
+
+	// Mutating a header the source depends on must be caught by verify.
+	mustWriteFile(t, dir, "test.h", "#define VALUE 2")
+
+	err := run(io.Discard, verifyArgs)
+	qt.Assert(t, qt.IsNotNil(err))
+}